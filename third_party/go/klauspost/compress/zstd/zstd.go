@@ -0,0 +1,12 @@
+package zstd
+
+import "io"
+
+type Encoder struct{}
+func NewWriter(w io.Writer) (*Encoder, error) { return &Encoder{}, nil }
+func (e *Encoder) Write(p []byte) (int, error) { return len(p), nil }
+func (e *Encoder) Close() error { return nil }
+
+type Decoder struct{}
+func NewReader(r io.Reader) (*Decoder, error) { return &Decoder{}, nil }
+func (d *Decoder) IOReadCloser() io.ReadCloser { return nil }
@@ -0,0 +1,10 @@
+package lz4
+
+import "io"
+
+type Writer struct{ io.Writer }
+func NewWriter(w io.Writer) *Writer { return &Writer{w} }
+func (w *Writer) Close() error { return nil }
+
+type Reader struct{ io.Reader }
+func NewReader(r io.Reader) *Reader { return &Reader{r} }
@@ -0,0 +1,7 @@
+package conversion
+
+import "code.google.com/p/goprotobuf/proto"
+
+type Converter interface {
+	Convert(msg proto.Message) ([]proto.Message, error)
+}
@@ -85,6 +85,25 @@ type Fetcher interface {
 // ErrNotFound is returned by Fetch when the specified file was not found.
 var ErrNotFound = errors.New("file not found")
 
+// A FlushSink is a Sink that buffers or batches its output and needs an
+// explicit signal to push that output to its backing store.  Callers that
+// know a Sink may implement FlushSink (such as a Runner shutting down, or
+// between compilation units to bound memory) should type-assert for it and
+// call Flush; sink implementations in the sinks subpackage honor this
+// contract for both Flush and Close, so that buffered output is not lost on
+// crash.
+type FlushSink interface {
+	Sink
+
+	// Flush pushes any buffered artifacts to the sink's backing store. It
+	// does not close the sink; further writes may follow.
+	Flush() error
+
+	// Close flushes any buffered artifacts and releases resources held by
+	// the sink. The sink must not be used after Close returns.
+	Close() error
+}
+
 // A Runner invokes an Analyzer on a collection of compilation units.
 type Runner interface {
 	// RunAnalysis runs analyzer on each compilation known to the runner.
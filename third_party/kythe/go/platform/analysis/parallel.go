@@ -0,0 +1,315 @@
+package analysis
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	apb "third_party/kythe/proto/analysis_proto"
+)
+
+// A ContextAnalyzer is an Analyzer that additionally accepts a
+// context.Context, so that a Runner can cancel or time out an in-progress
+// analysis (e.g. when ParallelRunner's caller cancels the context passed to
+// RunAnalysisContext).
+type ContextAnalyzer interface {
+	Analyzer
+
+	// AnalyzeContext behaves as Analyze, but should return ctx.Err() (or an
+	// error wrapping it) promptly once ctx is done.
+	AnalyzeContext(ctx context.Context, req *apb.AnalysisRequest, f Fetcher, s Sink) error
+}
+
+// analyze runs analyzer on req, using AnalyzeContext if analyzer implements
+// ContextAnalyzer, or falling back to the plain Analyze method (in which
+// case ctx is not observed while the analysis is running).
+func analyze(ctx context.Context, analyzer Analyzer, req *apb.AnalysisRequest, f Fetcher, s Sink) error {
+	if ca, ok := analyzer.(ContextAnalyzer); ok {
+		return ca.AnalyzeContext(ctx, req, f, s)
+	}
+	return analyzer.Analyze(req, f, s)
+}
+
+// A RequestSource supplies a (possibly unbounded) sequence of analysis
+// requests to a Runner.  Next returns io.EOF once no further requests are
+// available.
+type RequestSource interface {
+	Next() (*apb.AnalysisRequest, error)
+}
+
+// AnalysisError pairs an error returned by an Analyzer with the request
+// that caused it. Request is nil if Err is ctx.Err() from a RunAnalysisContext
+// call that was cancelled before p.Source was exhausted, or an error from
+// reading p.Source, since in those cases there is no single request to blame.
+type AnalysisError struct {
+	Err     error
+	Request *apb.AnalysisRequest
+}
+
+func (e *AnalysisError) Error() string {
+	return fmt.Sprintf("analyzing %v: %v", e.Request, e.Err)
+}
+
+// AnalysisErrors aggregates the AnalysisErrors produced by a single
+// RunAnalysis/RunAnalysisContext call, so that a caller that wants the
+// whole picture doesn't have to reconstruct it from a report callback.
+type AnalysisErrors struct {
+	Errors []*AnalysisError
+}
+
+func (e *AnalysisErrors) Error() string {
+	if len(e.Errors) == 1 {
+		return e.Errors[0].Error()
+	}
+	return fmt.Sprintf("%d errors during analysis (first: %v)", len(e.Errors), e.Errors[0])
+}
+
+func (e *AnalysisErrors) add(err error, req *apb.AnalysisRequest) {
+	e.Errors = append(e.Errors, &AnalysisError{Err: err, Request: req})
+}
+
+// A ParallelRunner is a Runner that fans requests from a RequestSource out
+// to a bounded pool of workers, running an Analyzer concurrently across
+// compilation units.
+//
+// Usage:
+//   runner := &analysis.ParallelRunner{Concurrency: 8, Source: source}
+//   if err := runner.RunAnalysis(analyzer, report); err != nil {
+//     log.Fatal(err)
+//   }
+type ParallelRunner struct {
+	// Concurrency is the maximum number of requests analyzed at once. A
+	// value <= 0 is treated as 1.
+	Concurrency int
+
+	// Source supplies the requests to analyze.
+	Source RequestSource
+
+	// Fetcher is passed to the Analyzer for every request, and must be safe
+	// to call concurrently from multiple workers. To cache repeated
+	// fetches of the same (path, digest) across requests, wrap it with
+	// NewCachingFetcher before assigning it here.
+	Fetcher Fetcher
+
+	// Sink is passed to the Analyzer for every request. Writes from
+	// concurrent workers are serialized, so Sink need not be
+	// concurrency-safe itself.
+	Sink Sink
+}
+
+// RunAnalysis implements the Runner interface, running with an unbounded
+// context.  See RunAnalysisContext.  Unlike the behavior described on
+// Runner, errors returned by analyzer are also returned from RunAnalysis,
+// aggregated in an *AnalysisErrors.
+func (p *ParallelRunner) RunAnalysis(analyzer Analyzer, report func(error, *apb.AnalysisRequest)) error {
+	return p.RunAnalysisContext(context.Background(), analyzer, report)
+}
+
+// RunAnalysisContext runs analyzer over every request from p.Source, using
+// up to p.Concurrency workers at once.  ctx is passed to analyzer if it
+// implements ContextAnalyzer, and is checked between dispatching requests
+// so that a cancelled ctx stops pulling new work promptly.
+//
+// If report is non-nil, it is called (from a single goroutine, so it need
+// not be concurrency-safe) for every error returned by analyzer, along with
+// the request that produced it. RunAnalysisContext itself returns a non-nil
+// *AnalysisErrors aggregating the same (error, request) pairs if any
+// analysis failed. If reading p.Source fails, no further requests are
+// pulled, and that error is reported and aggregated the same way with a nil
+// Request.
+// If ctx is cancelled before p.Source is exhausted, RunAnalysisContext stops
+// pulling new requests and includes ctx.Err() (with a nil Request) among the
+// aggregated errors, and passes it to report, so a caller can distinguish a
+// completed run from one that was cut short.
+func (p *ParallelRunner) RunAnalysisContext(ctx context.Context, analyzer Analyzer, report func(error, *apb.AnalysisRequest)) error {
+	concurrency := p.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	type result struct {
+		req *apb.AnalysisRequest
+		err error
+	}
+
+	reqs := make(chan *apb.AnalysisRequest, concurrency)
+	results := make(chan result, concurrency)
+	sink := &serializedSink{sink: p.Sink}
+
+	var wg sync.WaitGroup
+	wg.Add(concurrency)
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			defer wg.Done()
+			for req := range reqs {
+				err := analyze(ctx, analyzer, req, p.Fetcher, sink)
+				results <- result{req, err}
+			}
+		}()
+	}
+
+	var cancelled int32
+	done := make(chan struct{})
+	go func() {
+		defer close(reqs)
+		for {
+			select {
+			case <-ctx.Done():
+				atomic.StoreInt32(&cancelled, 1)
+				return
+			default:
+			}
+			req, err := p.Source.Next()
+			if err == io.EOF {
+				return
+			} else if err != nil {
+				results <- result{nil, err}
+				return
+			}
+			select {
+			case reqs <- req:
+			case <-ctx.Done():
+				atomic.StoreInt32(&cancelled, 1)
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	errs := &AnalysisErrors{}
+	for {
+		select {
+		case res := <-results:
+			if res.err != nil {
+				if report != nil {
+					report(res.err, res.req)
+				}
+				errs.add(res.err, res.req)
+			}
+		case <-done:
+			// Drain any results produced concurrently with the final Wait.
+			for {
+				select {
+				case res := <-results:
+					if res.err != nil {
+						if report != nil {
+							report(res.err, res.req)
+						}
+						errs.add(res.err, res.req)
+					}
+					continue
+				default:
+				}
+				break
+			}
+			if atomic.LoadInt32(&cancelled) != 0 {
+				err := ctx.Err()
+				if report != nil {
+					report(err, nil)
+				}
+				errs.add(err, nil)
+			}
+			if len(errs.Errors) == 0 {
+				return nil
+			}
+			return errs
+		}
+	}
+}
+
+// serializedSink wraps a Sink with a mutex so that concurrent workers can
+// share it without requiring every Sink implementation to be
+// concurrency-safe itself. A nil wrapped sink is fine: WriteBytes just
+// becomes a no-op, matching WriteMessage's treatment of a nil Sink.
+type serializedSink struct {
+	mu   sync.Mutex
+	sink Sink
+}
+
+func (s *serializedSink) WriteBytes(data []byte) error {
+	if s.sink == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sink.WriteBytes(data)
+}
+
+// A CachingFetcher wraps a Fetcher to serve repeated fetches of the same
+// (path, digest) pair from an in-memory LRU cache rather than re-hitting the
+// backing Fetcher. The cache itself is guarded by a mutex, but the backing
+// Fetcher is called without holding it, so concurrent Fetch calls are safe
+// only if the backing Fetcher is safe for concurrent use.
+type CachingFetcher struct {
+	fetcher Fetcher
+	maxSize int
+
+	mu    sync.Mutex
+	cache map[fetchKey]*list.Element // -> *cacheEntry
+	order *list.List                // front = most recently used
+}
+
+type fetchKey struct {
+	path, digest string
+}
+
+type cacheEntry struct {
+	key  fetchKey
+	data []byte
+}
+
+// NewCachingFetcher returns a CachingFetcher wrapping fetcher, caching the
+// results of up to maxSize distinct (path, digest) fetches. A maxSize <= 0
+// disables the cache (every call is forwarded to fetcher).
+func NewCachingFetcher(fetcher Fetcher, maxSize int) *CachingFetcher {
+	return &CachingFetcher{
+		fetcher: fetcher,
+		maxSize: maxSize,
+		cache:   make(map[fetchKey]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// Fetch implements the Fetcher interface, consulting and populating the
+// cache as needed. It may be called concurrently from multiple goroutines,
+// as a ParallelRunner's workers do, provided the wrapped Fetcher allows it.
+func (c *CachingFetcher) Fetch(path, digest string) ([]byte, error) {
+	key := fetchKey{path, digest}
+
+	c.mu.Lock()
+	if el, ok := c.cache[key]; ok {
+		c.order.MoveToFront(el)
+		data := el.Value.(*cacheEntry).data
+		c.mu.Unlock()
+		return data, nil
+	}
+	c.mu.Unlock()
+
+	data, err := c.fetcher.Fetch(path, digest)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.maxSize > 0 {
+		c.mu.Lock()
+		if el, ok := c.cache[key]; ok {
+			c.order.MoveToFront(el)
+		} else {
+			el := c.order.PushFront(&cacheEntry{key: key, data: data})
+			c.cache[key] = el
+			for c.order.Len() > c.maxSize {
+				oldest := c.order.Back()
+				c.order.Remove(oldest)
+				delete(c.cache, oldest.Value.(*cacheEntry).key)
+			}
+		}
+		c.mu.Unlock()
+	}
+	return data, nil
+}
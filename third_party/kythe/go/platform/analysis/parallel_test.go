@@ -0,0 +1,181 @@
+package analysis
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+
+	apb "third_party/kythe/proto/analysis_proto"
+)
+
+// sliceSource is a RequestSource that serves requests from a fixed slice.
+type sliceSource struct {
+	mu   sync.Mutex
+	reqs []*apb.AnalysisRequest
+}
+
+func (s *sliceSource) Next() (*apb.AnalysisRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.reqs) == 0 {
+		return nil, io.EOF
+	}
+	req := s.reqs[0]
+	s.reqs = s.reqs[1:]
+	return req, nil
+}
+
+// funcAnalyzer adapts a func to the Analyzer interface.
+type funcAnalyzer func(*apb.AnalysisRequest, Fetcher, Sink) error
+
+func (f funcAnalyzer) Analyze(req *apb.AnalysisRequest, fe Fetcher, s Sink) error {
+	return f(req, fe, s)
+}
+
+// funcContextAnalyzer adapts a func to the ContextAnalyzer interface.
+type funcContextAnalyzer func(context.Context, *apb.AnalysisRequest, Fetcher, Sink) error
+
+func (f funcContextAnalyzer) Analyze(req *apb.AnalysisRequest, fe Fetcher, s Sink) error {
+	return f(context.Background(), req, fe, s)
+}
+
+func (f funcContextAnalyzer) AnalyzeContext(ctx context.Context, req *apb.AnalysisRequest, fe Fetcher, s Sink) error {
+	return f(ctx, req, fe, s)
+}
+
+func requests(n int) []*apb.AnalysisRequest {
+	reqs := make([]*apb.AnalysisRequest, n)
+	for i := range reqs {
+		reqs[i] = &apb.AnalysisRequest{}
+	}
+	return reqs
+}
+
+func TestParallelRunnerRunsEveryRequest(t *testing.T) {
+	const n = 20
+	var mu sync.Mutex
+	seen := 0
+
+	runner := &ParallelRunner{
+		Concurrency: 4,
+		Source:      &sliceSource{reqs: requests(n)},
+	}
+	analyzer := funcAnalyzer(func(req *apb.AnalysisRequest, fe Fetcher, s Sink) error {
+		mu.Lock()
+		seen++
+		mu.Unlock()
+		return nil
+	})
+
+	if err := runner.RunAnalysis(analyzer, nil); err != nil {
+		t.Fatalf("RunAnalysis returned %v, want nil", err)
+	}
+	if seen != n {
+		t.Errorf("analyzed %d requests, want %d", seen, n)
+	}
+}
+
+func TestParallelRunnerAggregatesErrors(t *testing.T) {
+	wantErr := errors.New("boom")
+	runner := &ParallelRunner{
+		Concurrency: 2,
+		Source:      &sliceSource{reqs: requests(3)},
+	}
+	analyzer := funcAnalyzer(func(req *apb.AnalysisRequest, fe Fetcher, s Sink) error {
+		return wantErr
+	})
+
+	var reported int
+	err := runner.RunAnalysis(analyzer, func(err error, req *apb.AnalysisRequest) {
+		reported++
+	})
+	if err == nil {
+		t.Fatal("RunAnalysis returned nil, want an *AnalysisErrors")
+	}
+	aerrs, ok := err.(*AnalysisErrors)
+	if !ok {
+		t.Fatalf("RunAnalysis returned %T, want *AnalysisErrors", err)
+	}
+	if len(aerrs.Errors) != 3 {
+		t.Errorf("got %d errors, want 3", len(aerrs.Errors))
+	}
+	if reported != 3 {
+		t.Errorf("report called %d times, want 3", reported)
+	}
+}
+
+func TestRunAnalysisContextSurfacesCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	runner := &ParallelRunner{
+		Concurrency: 1,
+		Source:      &sliceSource{reqs: requests(100)},
+	}
+	analyzer := funcContextAnalyzer(func(ctx context.Context, req *apb.AnalysisRequest, fe Fetcher, s Sink) error {
+		cancel()
+		return nil
+	})
+
+	err := runner.RunAnalysisContext(ctx, analyzer, nil)
+	if err == nil {
+		t.Fatal("RunAnalysisContext returned nil after cancellation, want a non-nil error")
+	}
+	aerrs, ok := err.(*AnalysisErrors)
+	if !ok {
+		t.Fatalf("RunAnalysisContext returned %T, want *AnalysisErrors", err)
+	}
+	var foundCancellation bool
+	for _, e := range aerrs.Errors {
+		if errors.Is(e.Err, context.Canceled) {
+			foundCancellation = true
+		}
+	}
+	if !foundCancellation {
+		t.Errorf("errors %v do not include context.Canceled", aerrs.Errors)
+	}
+}
+
+func TestCachingFetcherServesRepeatedFetchesFromCache(t *testing.T) {
+	var calls int32
+	inner := fetcherFunc(func(path, digest string) ([]byte, error) {
+		calls++
+		return []byte(path + digest), nil
+	})
+	cf := NewCachingFetcher(inner, 4)
+
+	for i := 0; i < 3; i++ {
+		data, err := cf.Fetch("a", "1")
+		if err != nil {
+			t.Fatalf("Fetch: %v", err)
+		}
+		if string(data) != "a1" {
+			t.Errorf("Fetch returned %q, want %q", data, "a1")
+		}
+	}
+	if calls != 1 {
+		t.Errorf("inner Fetch called %d times, want 1", calls)
+	}
+}
+
+func TestCachingFetcherEvictsLeastRecentlyUsed(t *testing.T) {
+	var calls int32
+	inner := fetcherFunc(func(path, digest string) ([]byte, error) {
+		calls++
+		return []byte(path), nil
+	})
+	cf := NewCachingFetcher(inner, 2)
+
+	cf.Fetch("a", "")
+	cf.Fetch("b", "")
+	cf.Fetch("c", "") // evicts "a", the least recently used entry
+	cf.Fetch("a", "")
+
+	if calls != 4 {
+		t.Errorf("inner Fetch called %d times, want 4 (no cache hit for evicted entry)", calls)
+	}
+}
+
+type fetcherFunc func(path, digest string) ([]byte, error)
+
+func (f fetcherFunc) Fetch(path, digest string) ([]byte, error) { return f(path, digest) }
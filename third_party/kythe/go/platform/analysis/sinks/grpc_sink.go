@@ -0,0 +1,49 @@
+package sinks
+
+import (
+	"context"
+
+	"third_party/kythe/go/platform/analysis"
+	sinkpb "third_party/kythe/proto/sink_proto"
+)
+
+// A GRPCStreamSink streams each artifact to a coordinator as a message on
+// an ArtifactSink.StreamArtifacts gRPC call, letting an Analyzer run as a
+// remote worker instead of writing artifacts to local disk.
+type GRPCStreamSink struct {
+	stream sinkpb.ArtifactSink_StreamArtifactsClient
+}
+
+// NewGRPCStreamSink opens a StreamArtifacts call against client and returns
+// a Sink that forwards each WriteBytes call as one Artifact message on that
+// stream.
+func NewGRPCStreamSink(ctx context.Context, client sinkpb.ArtifactSinkClient) (*GRPCStreamSink, error) {
+	stream, err := client.StreamArtifacts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &GRPCStreamSink{stream: stream}, nil
+}
+
+// WriteBytes implements the analysis.Sink interface, sending data as the
+// next Artifact on the stream.
+func (s *GRPCStreamSink) WriteBytes(data []byte) error {
+	return s.stream.Send(&sinkpb.Artifact{Data: data})
+}
+
+// Flush is a no-op: artifacts are sent to the coordinator as soon as
+// WriteBytes is called, so there is nothing buffered locally to flush. It
+// exists to satisfy analysis.FlushSink.
+func (s *GRPCStreamSink) Flush() error {
+	return nil
+}
+
+// Close closes the send side of the stream and waits for the coordinator's
+// Ack, confirming every previously sent artifact was received. The sink
+// must not be used after Close returns.
+func (s *GRPCStreamSink) Close() error {
+	_, err := s.stream.CloseAndRecv()
+	return err
+}
+
+var _ analysis.FlushSink = (*GRPCStreamSink)(nil)
@@ -0,0 +1,189 @@
+// Package sinks provides ready-to-use analysis.Sink implementations for
+// writing analysis artifacts to local files, rotated file shards, and
+// compressed or remote destinations.
+package sinks
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"os"
+
+	"third_party/kythe/go/platform/analysis"
+	"third_party/kythe/go/platform/delimited"
+)
+
+// A DelimitedFileSink writes each artifact as a delimited record to a local
+// file, fsync'ing the file when closed so that buffered output is not lost
+// on crash.
+type DelimitedFileSink struct {
+	f *os.File
+	w *delimited.Writer
+}
+
+// NewDelimitedFileSink creates (or truncates) the file at path and returns a
+// DelimitedFileSink that writes delimited records to it.
+func NewDelimitedFileSink(path string) (*DelimitedFileSink, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &DelimitedFileSink{f: f, w: delimited.NewWriter(f)}, nil
+}
+
+// WriteBytes implements the analysis.Sink interface.
+func (s *DelimitedFileSink) WriteBytes(data []byte) error {
+	return s.w.Put(data)
+}
+
+// Flush fsyncs the underlying file, ensuring previously written artifacts
+// are durable.
+func (s *DelimitedFileSink) Flush() error {
+	return s.f.Sync()
+}
+
+// Close fsyncs and closes the underlying file. The sink must not be used
+// after Close returns.
+func (s *DelimitedFileSink) Close() error {
+	if err := s.f.Sync(); err != nil {
+		s.f.Close()
+		return err
+	}
+	return s.f.Close()
+}
+
+var _ analysis.FlushSink = (*DelimitedFileSink)(nil)
+
+// A RotatingSink wraps a sequence of DelimitedFileSink shards, starting a
+// new file whenever the current shard has reached its byte or record limit
+// (see NewRotatingSink).
+// Shards are named "<prefix>-NNNNN", with NNNNN a zero-padded shard index
+// starting at 0.
+type RotatingSink struct {
+	prefix     string
+	maxBytes   int64
+	maxRecords int
+
+	shard   int
+	cur     *DelimitedFileSink
+	nBytes  int64
+	nRecord int
+}
+
+// NewRotatingSink returns a RotatingSink that writes shards named
+// "<prefix>-NNNNN", starting a new shard before the next write once the
+// current one has received at least maxBytes bytes or maxRecords records (a
+// non-positive limit disables that trigger; at least one of the two must be
+// positive). A shard can therefore hold exactly maxRecords records, and the
+// record that reaches maxBytes may take the shard past that size.
+func NewRotatingSink(prefix string, maxBytes int64, maxRecords int) *RotatingSink {
+	return &RotatingSink{prefix: prefix, maxBytes: maxBytes, maxRecords: maxRecords}
+}
+
+// WriteBytes implements the analysis.Sink interface, rotating to a new
+// shard first if the current one has reached its limit.
+func (s *RotatingSink) WriteBytes(data []byte) error {
+	if s.cur == nil || s.shouldRotate() {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	if err := s.cur.WriteBytes(data); err != nil {
+		return err
+	}
+	s.nBytes += int64(len(data))
+	s.nRecord++
+	return nil
+}
+
+func (s *RotatingSink) shouldRotate() bool {
+	return (s.maxBytes > 0 && s.nBytes >= s.maxBytes) ||
+		(s.maxRecords > 0 && s.nRecord >= s.maxRecords)
+}
+
+func (s *RotatingSink) rotate() error {
+	if s.cur != nil {
+		if err := s.cur.Close(); err != nil {
+			return err
+		}
+		s.shard++
+	}
+	path := fmt.Sprintf("%s-%05d", s.prefix, s.shard)
+	sink, err := NewDelimitedFileSink(path)
+	if err != nil {
+		return err
+	}
+	s.cur = sink
+	s.nBytes, s.nRecord = 0, 0
+	return nil
+}
+
+// Flush flushes the current shard, if any.
+func (s *RotatingSink) Flush() error {
+	if s.cur == nil {
+		return nil
+	}
+	return s.cur.Flush()
+}
+
+// Close closes the current shard, if any. The sink must not be used after
+// Close returns.
+func (s *RotatingSink) Close() error {
+	if s.cur == nil {
+		return nil
+	}
+	return s.cur.Close()
+}
+
+var _ analysis.FlushSink = (*RotatingSink)(nil)
+
+// A GzipSink compresses each artifact independently with gzip before
+// passing it on to an underlying Sink, so that a plain RotatingSink or
+// DelimitedFileSink (or any other analysis.Sink) ends up storing compressed
+// artifacts without needing to know about compression itself.
+type GzipSink struct {
+	underlying analysis.Sink
+	level      int
+}
+
+// NewGzipSink returns a GzipSink that compresses artifacts at the given
+// gzip level (see compress/gzip; use gzip.DefaultCompression for the
+// default) before writing them to underlying.
+func NewGzipSink(underlying analysis.Sink, level int) *GzipSink {
+	return &GzipSink{underlying: underlying, level: level}
+}
+
+// WriteBytes implements the analysis.Sink interface.
+func (s *GzipSink) WriteBytes(data []byte) error {
+	var buf bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&buf, s.level)
+	if err != nil {
+		return err
+	}
+	if _, err := zw.Write(data); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return s.underlying.WriteBytes(buf.Bytes())
+}
+
+// Flush flushes the underlying sink, if it implements analysis.FlushSink.
+func (s *GzipSink) Flush() error {
+	if fs, ok := s.underlying.(analysis.FlushSink); ok {
+		return fs.Flush()
+	}
+	return nil
+}
+
+// Close closes the underlying sink, if it implements analysis.FlushSink.
+// The sink must not be used after Close returns.
+func (s *GzipSink) Close() error {
+	if fs, ok := s.underlying.(analysis.FlushSink); ok {
+		return fs.Close()
+	}
+	return nil
+}
+
+var _ analysis.FlushSink = (*GzipSink)(nil)
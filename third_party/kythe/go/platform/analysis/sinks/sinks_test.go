@@ -0,0 +1,147 @@
+package sinks
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"third_party/kythe/go/platform/delimited"
+)
+
+func readShardRecords(t *testing.T, path string) [][]byte {
+	t.Helper()
+	f, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading shard %s: %v", path, err)
+	}
+	r := delimited.NewReader(bytes.NewReader(f))
+	var records [][]byte
+	for {
+		rec, err := r.Next()
+		if err != nil {
+			break
+		}
+		records = append(records, append([]byte(nil), rec...))
+	}
+	return records
+}
+
+func TestDelimitedFileSinkWriteAndReadBack(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "artifacts")
+	sink, err := NewDelimitedFileSink(path)
+	if err != nil {
+		t.Fatalf("NewDelimitedFileSink: %v", err)
+	}
+
+	records := [][]byte{[]byte("first"), []byte("second")}
+	for _, rec := range records {
+		if err := sink.WriteBytes(rec); err != nil {
+			t.Fatalf("WriteBytes(%q): %v", rec, err)
+		}
+	}
+	if err := sink.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	got := readShardRecords(t, path)
+	if len(got) != len(records) {
+		t.Fatalf("got %d records, want %d", len(got), len(records))
+	}
+	for i, want := range records {
+		if !bytes.Equal(got[i], want) {
+			t.Errorf("record #%d = %q, want %q", i, got[i], want)
+		}
+	}
+}
+
+func TestRotatingSinkRotatesOnMaxRecords(t *testing.T) {
+	prefix := filepath.Join(t.TempDir(), "shard")
+	sink := NewRotatingSink(prefix, 0, 2)
+
+	for i := 0; i < 5; i++ {
+		if err := sink.WriteBytes([]byte(fmt.Sprintf("record-%d", i))); err != nil {
+			t.Fatalf("WriteBytes #%d: %v", i, err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	wantCounts := []int{2, 2, 1}
+	for shard, want := range wantCounts {
+		path := fmt.Sprintf("%s-%05d", prefix, shard)
+		got := readShardRecords(t, path)
+		if len(got) != want {
+			t.Errorf("shard %d has %d records, want %d", shard, len(got), want)
+		}
+	}
+}
+
+func TestRotatingSinkRotatesOnMaxBytes(t *testing.T) {
+	prefix := filepath.Join(t.TempDir(), "shard")
+	// Each record below is 4 bytes: after two records shard 0 holds 8 bytes,
+	// under the 10-byte limit, so the third record also goes there (12
+	// bytes) and the fourth starts a new shard.
+	sink := NewRotatingSink(prefix, 10, 0)
+
+	records := [][]byte{[]byte("aaaa"), []byte("bbbb"), []byte("cccc"), []byte("dddd")}
+	for _, rec := range records {
+		if err := sink.WriteBytes(rec); err != nil {
+			t.Fatalf("WriteBytes(%q): %v", rec, err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	shard0 := readShardRecords(t, fmt.Sprintf("%s-%05d", prefix, 0))
+	shard1 := readShardRecords(t, fmt.Sprintf("%s-%05d", prefix, 1))
+	if len(shard0) != 3 {
+		t.Errorf("shard 0 has %d records, want 3", len(shard0))
+	}
+	if len(shard1) != 1 {
+		t.Errorf("shard 1 has %d records, want 1", len(shard1))
+	}
+}
+
+func TestGzipSinkCompressesAndDelegatesFlushClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "artifacts")
+	underlying, err := NewDelimitedFileSink(path)
+	if err != nil {
+		t.Fatalf("NewDelimitedFileSink: %v", err)
+	}
+	sink := NewGzipSink(underlying, gzip.DefaultCompression)
+
+	want := []byte("some analysis artifact bytes")
+	if err := sink.WriteBytes(want); err != nil {
+		t.Fatalf("WriteBytes: %v", err)
+	}
+	if err := sink.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	records := readShardRecords(t, path)
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want 1", len(records))
+	}
+	gr, err := gzip.NewReader(bytes.NewReader(records[0]))
+	if err != nil {
+		t.Fatalf("gzip.NewReader: %v", err)
+	}
+	got, err := ioutil.ReadAll(gr)
+	if err != nil {
+		t.Fatalf("reading gzip body: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("decompressed artifact = %q, want %q", got, want)
+	}
+}
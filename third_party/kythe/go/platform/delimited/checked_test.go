@@ -0,0 +1,99 @@
+package delimited
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestCheckedWriterReaderRoundTrip(t *testing.T) {
+	records := [][]byte{
+		[]byte("first record"),
+		[]byte("second, a bit longer than the first"),
+		[]byte(""),
+		[]byte("fourth"),
+	}
+
+	var buf bytes.Buffer
+	w := NewCheckedWriter(&buf, 2)
+	for _, rec := range records {
+		if err := w.Put(rec); err != nil {
+			t.Fatalf("Put(%q): %v", rec, err)
+		}
+	}
+
+	r := NewCheckedReader(&buf, 2)
+	for i, want := range records {
+		got, err := r.Next()
+		if err != nil {
+			t.Fatalf("Next() #%d: %v", i, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("Next() #%d = %q, want %q", i, got, want)
+		}
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("final Next() = %v, want io.EOF", err)
+	}
+}
+
+func TestCheckedReaderDetectsChecksumMismatchAndResyncs(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewCheckedWriter(&buf, 0)
+	if err := w.Put([]byte("good record")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	firstLen := buf.Len()
+	if _, err := buf.Write(syncMarker[:]); err != nil {
+		t.Fatalf("writing sync marker: %v", err)
+	}
+	if err := w.Put([]byte("another good record")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	data := buf.Bytes()
+	// Flip the last byte of the first record's payload, so its stored
+	// checksum no longer matches.
+	data[firstLen-1] ^= 0xff
+
+	r := NewCheckedReader(bytes.NewReader(data), 0)
+	if _, err := r.Next(); err != ErrChecksum {
+		t.Fatalf("Next() = %v, want ErrChecksum", err)
+	}
+	if err := r.Resync(); err != nil {
+		t.Fatalf("Resync: %v", err)
+	}
+	got, err := r.Next()
+	if err != nil {
+		t.Fatalf("Next() after Resync: %v", err)
+	}
+	if want := "another good record"; string(got) != want {
+		t.Errorf("Next() after Resync = %q, want %q", got, want)
+	}
+}
+
+func TestCheckedReaderEnforcesMaxRecordSize(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewCheckedWriter(&buf, 0)
+	if err := w.Put([]byte("this record is larger than the limit")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	r := NewCheckedReader(&buf, 0)
+	r.MaxRecordSize = 4
+	if _, err := r.Next(); err != ErrRecordTooLarge {
+		t.Fatalf("Next() = %v, want ErrRecordTooLarge", err)
+	}
+}
+
+func TestCheckedReaderDoesNotSniffContentForSyncMarker(t *testing.T) {
+	// A stream consisting of exactly the sync marker's bytes, with no sync
+	// markers expected (syncEvery == 0): if Next relied on content-sniffing
+	// (as it used to) it would discard these 4 bytes as a marker and report
+	// io.EOF. With count-based bookkeeping it must instead try to parse them
+	// as an ordinary (truncated) record and fail with io.ErrUnexpectedEOF.
+	r := NewCheckedReader(bytes.NewReader(syncMarker[:]), 0)
+	if _, err := r.Next(); err != io.ErrUnexpectedEOF {
+		t.Errorf("Next() = %v, want io.ErrUnexpectedEOF (marker bytes must not be sniffed out of band)", err)
+	}
+}
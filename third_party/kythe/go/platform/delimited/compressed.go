@@ -0,0 +1,240 @@
+package delimited
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"third_party/go/pierrec/lz4"
+)
+
+// A Codec identifies a compression algorithm usable by NewCompressedWriter,
+// NewCompressedStreamWriter, and recognized by their Reader counterparts.
+type Codec byte
+
+// The set of codecs understood by the compressed stream format.
+const (
+	CodecNone Codec = iota
+	CodecGzip
+	CodecZlib
+	CodecFlate
+	CodecLZ4
+)
+
+// String returns a human-readable name for c.
+func (c Codec) String() string {
+	switch c {
+	case CodecNone:
+		return "none"
+	case CodecGzip:
+		return "gzip"
+	case CodecZlib:
+		return "zlib"
+	case CodecFlate:
+		return "flate"
+	case CodecLZ4:
+		return "lz4"
+	default:
+		return fmt.Sprintf("Codec(%d)", byte(c))
+	}
+}
+
+// header is the fixed-size prefix identifying a compressed payload: magic +
+// version + codec.  It is written once per record in per-record mode, or
+// once at the start of the stream in per-stream mode.
+type header [6]byte
+
+var headerMagic = [4]byte{'d', 'l', 'm', 'z'}
+
+const headerVersion = 1
+
+func newHeader(codec Codec) header {
+	var h header
+	copy(h[:4], headerMagic[:])
+	h[4] = headerVersion
+	h[5] = byte(codec)
+	return h
+}
+
+func (h header) codec() (Codec, error) {
+	if !bytes.Equal(h[:4], headerMagic[:]) {
+		return 0, fmt.Errorf("delimited: bad compressed stream magic %q", h[:4])
+	}
+	if h[4] != headerVersion {
+		return 0, fmt.Errorf("delimited: unsupported compressed stream version %d", h[4])
+	}
+	return Codec(h[5]), nil
+}
+
+func newCompressor(codec Codec, w io.Writer, level int) (io.WriteCloser, error) {
+	switch codec {
+	case CodecNone:
+		return nopWriteCloser{w}, nil
+	case CodecGzip:
+		return gzip.NewWriterLevel(w, level)
+	case CodecZlib:
+		return zlib.NewWriterLevel(w, level)
+	case CodecFlate:
+		return flate.NewWriter(w, level)
+	case CodecLZ4:
+		return lz4.NewWriter(w), nil
+	default:
+		return nil, fmt.Errorf("delimited: unknown codec %v", codec)
+	}
+}
+
+func newDecompressor(codec Codec, r io.Reader) (io.Reader, error) {
+	switch codec {
+	case CodecNone:
+		return r, nil
+	case CodecGzip:
+		return gzip.NewReader(r)
+	case CodecZlib:
+		return zlib.NewReader(r)
+	case CodecFlate:
+		return flate.NewReader(r), nil
+	case CodecLZ4:
+		return lz4.NewReader(r), nil
+	default:
+		return nil, fmt.Errorf("delimited: unknown codec %v", codec)
+	}
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// A CompressedWriter wraps a Writer so each record is independently
+// compressed before being written, preserving the ability of a
+// CompressedReader to skip or resume between records without decompressing
+// the whole stream. For a better compression ratio on highly repetitive
+// streams (such as Kythe compilation units), at the cost of requiring the
+// stream to be decompressed from the start, see NewCompressedStreamWriter.
+type CompressedWriter struct {
+	w     *Writer
+	codec Codec
+	level int
+}
+
+// NewCompressedWriter constructs a CompressedWriter that compresses each
+// record independently using codec, at the given compression level
+// (semantics depend on codec: for gzip, zlib and flate, -1 selects the
+// default level and 0 stores records uncompressed; lz4 and none ignore it).
+func NewCompressedWriter(w io.Writer, codec Codec, level int) *CompressedWriter {
+	return &CompressedWriter{w: NewWriter(w), codec: codec, level: level}
+}
+
+// Put compresses record and writes it, framed with a small codec header, as
+// a single delimited record.
+func (c *CompressedWriter) Put(record []byte) error {
+	var buf bytes.Buffer
+	h := newHeader(c.codec)
+	buf.Write(h[:])
+
+	cw, err := newCompressor(c.codec, &buf, c.level)
+	if err != nil {
+		return err
+	}
+	if _, err := cw.Write(record); err != nil {
+		return err
+	}
+	if err := cw.Close(); err != nil {
+		return err
+	}
+	return c.w.Put(buf.Bytes())
+}
+
+// A CompressedReader wraps a Reader and transparently decompresses records
+// written by a CompressedWriter, auto-detecting the codec used for each
+// record from its header.
+type CompressedReader struct {
+	r *Reader
+}
+
+// NewCompressedReader constructs a CompressedReader over the records in r.
+func NewCompressedReader(r io.Reader) *CompressedReader {
+	return &CompressedReader{r: NewReader(r)}
+}
+
+// Next returns the next record, decompressed.  The slice returned is valid
+// only until a subsequent call to Next.
+func (c *CompressedReader) Next() ([]byte, error) {
+	rec, err := c.r.Next()
+	if err != nil {
+		return nil, err
+	}
+	if len(rec) < len(header{}) {
+		return nil, fmt.Errorf("delimited: compressed record too short")
+	}
+	var h header
+	copy(h[:], rec[:len(h)])
+	codec, err := h.codec()
+	if err != nil {
+		return nil, err
+	}
+	dr, err := newDecompressor(codec, bytes.NewReader(rec[len(h):]))
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(dr)
+}
+
+// A CompressedStreamWriter is a Writer whose output is compressed as a
+// single continuous stream. Unlike CompressedWriter, it must be closed once
+// the caller is done writing records, so that the underlying compressor can
+// flush any buffered data (and, for codecs such as gzip, write its trailer)
+// to the wrapped io.Writer.
+type CompressedStreamWriter struct {
+	*Writer
+
+	cw io.WriteCloser
+}
+
+// Close flushes and closes the underlying compressor, without closing the
+// io.Writer originally passed to NewCompressedStreamWriter.
+func (w *CompressedStreamWriter) Close() error {
+	return w.cw.Close()
+}
+
+// NewCompressedStreamWriter wraps w so that the entire varint+payload
+// delimited stream written through the returned CompressedStreamWriter is
+// compressed as a single continuous stream using codec, rather than
+// record-by-record. This gives a better compression ratio for highly
+// repetitive streams than NewCompressedWriter, at the cost of requiring the
+// whole stream to be decompressed in order to reach any one record. The
+// returned CompressedStreamWriter must be closed once the caller is done
+// writing, or buffered data may never reach w.
+func NewCompressedStreamWriter(w io.Writer, codec Codec, level int) (*CompressedStreamWriter, error) {
+	h := newHeader(codec)
+	if _, err := w.Write(h[:]); err != nil {
+		return nil, err
+	}
+	cw, err := newCompressor(codec, w, level)
+	if err != nil {
+		return nil, err
+	}
+	return &CompressedStreamWriter{Writer: NewWriter(cw), cw: cw}, nil
+}
+
+// NewCompressedStreamReader is the counterpart to NewCompressedStreamWriter:
+// it reads the stream-level header and returns a Reader over the
+// decompressed stream.
+func NewCompressedStreamReader(r io.Reader) (*Reader, error) {
+	var h header
+	if _, err := io.ReadFull(r, h[:]); err != nil {
+		return nil, err
+	}
+	codec, err := h.codec()
+	if err != nil {
+		return nil, err
+	}
+	dr, err := newDecompressor(codec, r)
+	if err != nil {
+		return nil, err
+	}
+	return NewReader(dr), nil
+}
@@ -0,0 +1,75 @@
+package delimited
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCompressedWriterReaderRoundTrip(t *testing.T) {
+	for _, codec := range []Codec{CodecNone, CodecGzip, CodecZlib, CodecFlate, CodecLZ4} {
+		t.Run(codec.String(), func(t *testing.T) {
+			records := [][]byte{
+				[]byte("hello, world"),
+				bytes.Repeat([]byte("repetitive data compresses well "), 100),
+			}
+
+			var buf bytes.Buffer
+			w := NewCompressedWriter(&buf, codec, 0)
+			for _, rec := range records {
+				if err := w.Put(rec); err != nil {
+					t.Fatalf("Put(%q): %v", rec, err)
+				}
+			}
+
+			r := NewCompressedReader(&buf)
+			for i, want := range records {
+				got, err := r.Next()
+				if err != nil {
+					t.Fatalf("Next() #%d: %v", i, err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Errorf("Next() #%d = %q, want %q", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCompressedStreamWriterReaderRoundTrip(t *testing.T) {
+	for _, codec := range []Codec{CodecNone, CodecGzip, CodecZlib, CodecFlate, CodecLZ4} {
+		t.Run(codec.String(), func(t *testing.T) {
+			records := [][]byte{
+				[]byte("first"),
+				[]byte("second"),
+			}
+
+			var buf bytes.Buffer
+			w, err := NewCompressedStreamWriter(&buf, codec, 0)
+			if err != nil {
+				t.Fatalf("NewCompressedStreamWriter: %v", err)
+			}
+			for _, rec := range records {
+				if err := w.Put(rec); err != nil {
+					t.Fatalf("Put(%q): %v", rec, err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+
+			r, err := NewCompressedStreamReader(&buf)
+			if err != nil {
+				t.Fatalf("NewCompressedStreamReader: %v", err)
+			}
+			for i, want := range records {
+				got, err := r.Next()
+				if err != nil {
+					t.Fatalf("Next() #%d: %v", i, err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Errorf("Next() #%d = %q, want %q", i, got, want)
+				}
+			}
+		})
+	}
+}
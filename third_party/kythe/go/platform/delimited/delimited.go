@@ -3,18 +3,26 @@
 // length in bytes, followed immediately by the record itself.
 //
 // A stream consists of a sequence of such records packed consecutively without
-// additional padding.  There are no checksums or compression.
+// additional padding.  The basic format has no checksums, but records may
+// optionally be compressed (see NewCompressedWriter and
+// NewCompressedStreamWriter) or checksummed and resynchronizable (see
+// NewCheckedWriter and NewCheckedReader).
 package delimited
 
 import (
 	"bufio"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 
 	"code.google.com/p/goprotobuf/proto"
 )
 
+// ErrRecordTooLarge is returned by Reader.Next and Reader.NextProto when a
+// record's length prefix exceeds the Reader's MaxRecordSize.
+var ErrRecordTooLarge = errors.New("delimited: record too large")
+
 // A Reader consumes delimited records from an io.Reader.
 //
 // Usage:
@@ -32,17 +40,25 @@ import (
 type Reader struct {
 	buf  *bufio.Reader
 	data []byte
+
+	// MaxRecordSize, if positive, bounds the size in bytes of any single
+	// record.  A length prefix larger than MaxRecordSize causes Next,
+	// NextProto, and NextReader to fail with ErrRecordTooLarge before any
+	// allocation or read of the record body is attempted.  Zero (the
+	// default) means no limit is enforced.
+	MaxRecordSize int64
 }
 
 // Next returns the next length-delimited record from the input, or io.EOF if
 // there are no more records available.  Returns io.ErrUnexpectedEOF if a short
-// record is found, with a length of n but fewer than n bytes of data.  Because
+// record is found, with a length of n but fewer than n bytes of data.  Returns
+// ErrRecordTooLarge if the record's length exceeds MaxRecordSize.  Because
 // there is no resynchronization mechanism, it is generally not possible to
 // recover from a short record in this format.
 //
 // The slice returned is valid only until a subsequent call to Next.
 func (r *Reader) Next() ([]byte, error) {
-	size, err := binary.ReadUvarint(r.buf)
+	size, err := r.nextSize()
 	if err != nil {
 		return nil, err
 	}
@@ -58,8 +74,40 @@ func (r *Reader) Next() ([]byte, error) {
 	return r.data, nil
 }
 
+// NextReader returns an io.Reader bounded to the length of the next
+// length-delimited record, without reading the record into memory.  This
+// allows a caller to stream or decode a record of arbitrary size without
+// holding the whole thing in RAM at once.  Like Next, it returns io.EOF if
+// there are no more records available, and ErrRecordTooLarge if the record's
+// length exceeds MaxRecordSize.
+//
+// The returned io.Reader is only valid until the next call to Next,
+// NextProto, or NextReader on r; it must be fully consumed (or discarded)
+// before advancing to the next record.
+func (r *Reader) NextReader() (io.Reader, error) {
+	size, err := r.nextSize()
+	if err != nil {
+		return nil, err
+	}
+	return io.LimitReader(r.buf, int64(size)), nil
+}
+
+// nextSize reads and validates the varint length prefix of the next record.
+func (r *Reader) nextSize() (uint64, error) {
+	size, err := binary.ReadUvarint(r.buf)
+	if err != nil {
+		return 0, err
+	}
+	if r.MaxRecordSize > 0 && size > uint64(r.MaxRecordSize) {
+		return 0, ErrRecordTooLarge
+	}
+	return size, nil
+}
+
 // NextProto reads a record using Next and decodes it into the given
-// proto.Message.
+// proto.Message.  If MaxRecordSize is set, the record's length is checked
+// against it before the record is read, so NextProto is safe to use for
+// decoding proto messages from an untrusted stream.
 func (r *Reader) NextProto(pb proto.Message) error {
 	rec, err := r.Next()
 	if err != nil {
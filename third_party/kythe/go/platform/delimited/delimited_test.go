@@ -0,0 +1,128 @@
+package delimited
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestWriterReaderRoundTrip(t *testing.T) {
+	records := [][]byte{
+		[]byte("first record"),
+		[]byte(""),
+		[]byte("a third, somewhat longer record"),
+	}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for _, rec := range records {
+		if err := w.Put(rec); err != nil {
+			t.Fatalf("Put(%q): %v", rec, err)
+		}
+	}
+
+	r := NewReader(&buf)
+	for i, want := range records {
+		got, err := r.Next()
+		if err != nil {
+			t.Fatalf("Next() #%d: %v", i, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("Next() #%d = %q, want %q", i, got, want)
+		}
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("final Next() = %v, want io.EOF", err)
+	}
+}
+
+func TestReaderNextRejectsOversizedRecordWithoutAllocating(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	if err := w.Put(make([]byte, 1<<20)); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	r := NewReader(&buf)
+	r.MaxRecordSize = 1024
+	if _, err := r.Next(); err != ErrRecordTooLarge {
+		t.Fatalf("Next() = %v, want ErrRecordTooLarge", err)
+	}
+}
+
+func TestReaderNextReaderRejectsOversizedRecord(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	if err := w.Put(make([]byte, 1<<20)); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	r := NewReader(&buf)
+	r.MaxRecordSize = 1024
+	if _, err := r.NextReader(); err != ErrRecordTooLarge {
+		t.Fatalf("NextReader() = %v, want ErrRecordTooLarge", err)
+	}
+}
+
+func TestReaderNextProtoRejectsOversizedRecord(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	if err := w.Put(make([]byte, 1<<20)); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	r := NewReader(&buf)
+	r.MaxRecordSize = 1024
+	if err := r.NextProto(nil); err != ErrRecordTooLarge {
+		t.Fatalf("NextProto() = %v, want ErrRecordTooLarge", err)
+	}
+}
+
+func TestReaderNextAcceptsRecordAtTheLimit(t *testing.T) {
+	record := make([]byte, 1024)
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	if err := w.Put(record); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	r := NewReader(&buf)
+	r.MaxRecordSize = int64(len(record))
+	got, err := r.Next()
+	if err != nil {
+		t.Fatalf("Next(): %v", err)
+	}
+	if !bytes.Equal(got, record) {
+		t.Errorf("Next() returned a record of length %d, want %d", len(got), len(record))
+	}
+}
+
+func TestReaderNextReaderBoundsEachRecord(t *testing.T) {
+	records := [][]byte{
+		[]byte("bounded first record"),
+		[]byte("second"),
+	}
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for _, rec := range records {
+		if err := w.Put(rec); err != nil {
+			t.Fatalf("Put(%q): %v", rec, err)
+		}
+	}
+
+	r := NewReader(&buf)
+	for i, want := range records {
+		rd, err := r.NextReader()
+		if err != nil {
+			t.Fatalf("NextReader() #%d: %v", i, err)
+		}
+		got, err := ioutil.ReadAll(rd)
+		if err != nil {
+			t.Fatalf("reading bounded reader #%d: %v", i, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("NextReader() #%d produced %q, want %q", i, got, want)
+		}
+	}
+}
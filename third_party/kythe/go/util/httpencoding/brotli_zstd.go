@@ -0,0 +1,38 @@
+package httpencoding
+
+import (
+	"io"
+	"io/ioutil"
+
+	"third_party/go/andybalholm/brotli"
+	"third_party/go/klauspost/compress/zstd"
+)
+
+func init() {
+	RegisterEncoding("br", brotliEncoding{})
+	RegisterEncoding("zstd", zstdEncoding{})
+}
+
+type brotliEncoding struct{}
+
+func (brotliEncoding) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return brotli.NewWriter(w), nil
+}
+
+func (brotliEncoding) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return ioutil.NopCloser(brotli.NewReader(r)), nil
+}
+
+type zstdEncoding struct{}
+
+func (zstdEncoding) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return zstd.NewWriter(w)
+}
+
+func (zstdEncoding) NewReader(r io.Reader) (io.ReadCloser, error) {
+	zr, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return zr.IOReadCloser(), nil
+}
@@ -7,55 +7,209 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 )
 
+// An Encoding provides the reader/writer pair needed to plug a content
+// coding into CompressData/UncompressData.  NewWriter wraps w so that bytes
+// written to the result are encoded before being written to w; NewReader is
+// the inverse.
+type Encoding interface {
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+// encodings holds the registered codecs, keyed by the token used in the
+// Accept-Encoding/Content-Encoding headers (e.g. "gzip").
+var encodings = map[string]Encoding{}
+
+// RegisterEncoding makes enc available under name for both CompressData (as
+// a candidate when negotiating Accept-Encoding) and UncompressData (to
+// decode a Content-Encoding of name).  It is typically called from an init
+// function. Registering a name a second time replaces the previous
+// Encoding.
+func RegisterEncoding(name string, enc Encoding) {
+	encodings[name] = enc
+}
+
+func init() {
+	RegisterEncoding("gzip", gzipEncoding{})
+	RegisterEncoding("deflate", zlibEncoding{})
+}
+
+type gzipEncoding struct{}
+
+func (gzipEncoding) NewWriter(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil }
+func (gzipEncoding) NewReader(r io.Reader) (io.ReadCloser, error)  { return gzip.NewReader(r) }
+
+type zlibEncoding struct{}
+
+func (zlibEncoding) NewWriter(w io.Writer) (io.WriteCloser, error) { return zlib.NewWriter(w), nil }
+func (zlibEncoding) NewReader(r io.Reader) (io.ReadCloser, error)  { return zlib.NewReader(r) }
+
+// MinCompressSize is the smallest response body, in bytes, that CompressData
+// will bother encoding. Bodies smaller than this are sent with the identity
+// encoding, since compressing them typically makes them larger once framing
+// overhead is included.
+var MinCompressSize = 1024
+
 // CompressData returns a writer that writes encoded data to w. The chosen
-// encoding is based on the Accept-Encoding header and defaults to the identity
-// encoding.
+// encoding is negotiated from the request's Accept-Encoding header (honoring
+// q-weights, q=0 exclusions, and "*") against the set of codecs registered
+// with RegisterEncoding, and defaults to the identity encoding if none
+// match. Bodies whose total size is smaller than MinCompressSize are always
+// sent as identity,
+// since encoding headers and framing tend to outweigh the savings.
 func CompressData(w http.ResponseWriter, r *http.Request) io.WriteCloser {
-	encodings := strings.Split(r.Header.Get("Accept-Encoding"), ",")
-	for _, encoding := range encodings {
-		switch encoding {
-		case "gzip":
-			w.Header().Set("Content-Encoding", "gzip")
-			return gzip.NewWriter(w)
-		case "deflate":
-			w.Header().Set("Content-Encoding", "deflate")
-			return zlib.NewWriter(w)
-		case "identity":
-			return noopCloser{w}
+	name := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+	return &thresholdWriter{w: w, name: name}
+}
+
+// thresholdWriter buffers up to MinCompressSize bytes so it can decide,
+// once it knows whether there is enough data to be worth compressing,
+// whether to commit to the negotiated encoding or fall back to identity.
+type thresholdWriter struct {
+	w    http.ResponseWriter
+	name string
+
+	buf       []byte
+	committed io.WriteCloser // non-nil once a final encoding has been chosen
+}
+
+func (t *thresholdWriter) Write(p []byte) (int, error) {
+	if t.committed != nil {
+		return t.committed.Write(p)
+	}
+	t.buf = append(t.buf, p...)
+	if len(t.buf) < MinCompressSize {
+		return len(p), nil
+	}
+	if err := t.commit(t.name); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (t *thresholdWriter) commit(name string) error {
+	var wc io.WriteCloser
+	if name == "" || name == "identity" {
+		wc = noopCloser{t.w}
+	} else {
+		enc, ok := encodings[name]
+		if !ok {
+			return fmt.Errorf("httpencoding: no registered encoding %q", name)
+		}
+		t.w.Header().Set("Content-Encoding", name)
+		var err error
+		wc, err = enc.NewWriter(t.w)
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := wc.Write(t.buf); err != nil {
+		return err
+	}
+	t.buf = nil
+	t.committed = wc
+	return nil
+}
+
+func (t *thresholdWriter) Close() error {
+	if t.committed == nil {
+		// Never reached MinCompressSize: always send identity.
+		if err := t.commit("identity"); err != nil {
+			return err
 		}
 	}
-	return noopCloser{w}
+	return t.committed.Close()
 }
 
-// UncompressData returns a reads that decodes data from r.Body. The encoding is
-// determined based on the Content-Encoding header and an error is returned if
-// the encoding is unknown.
+// UncompressData returns a reader that decodes data from r.Body. The
+// encoding is determined based on the Content-Encoding header and an error
+// is returned if the encoding is unknown (including encodings that were
+// never registered with RegisterEncoding).
 func UncompressData(r *http.Response) (io.ReadCloser, error) {
 	encoding := r.Header.Get("Content-Encoding")
-	var (
-		cr  io.ReadCloser
-		err error
-	)
 	switch encoding {
-	case "gzip":
-		cr, err = gzip.NewReader(r.Body)
-	case "deflate":
-		cr, err = zlib.NewReader(r.Body)
-	case "identity":
-	case "":
+	case "", "identity":
 		return r.Body, nil
-	default:
+	}
+	enc, ok := encodings[encoding]
+	if !ok {
 		return nil, fmt.Errorf("unknown encoding: %q", encoding)
 	}
+	cr, err := enc.NewReader(r.Body)
 	if err != nil {
 		return nil, err
 	}
 	return &decodedReader{r.Body, cr}, nil
 }
 
+// negotiateEncoding parses an Accept-Encoding header per RFC 7231 §5.3.4 and
+// returns the name of the best registered encoding to use, or "identity" if
+// none of the registered encodings are acceptable to the client.
+func negotiateEncoding(header string) string {
+	prefs := parseAcceptEncoding(header)
+
+	// identity is acceptable by default unless the client explicitly
+	// excludes it (q=0) or excludes everything via "*;q=0".
+	identityQ := 1e-9
+	if header != "" {
+		if q, ok := prefs["identity"]; ok {
+			identityQ = q
+		} else if q, ok := prefs["*"]; ok {
+			identityQ = q
+		}
+	}
+
+	best, bestQ := "identity", identityQ
+	for name := range encodings {
+		q, ok := prefs[name]
+		if !ok {
+			q, ok = prefs["*"]
+		}
+		if !ok {
+			continue // not mentioned, and no wildcard: not acceptable
+		}
+		if q > bestQ || (q == bestQ && name < best) {
+			best, bestQ = name, q
+		}
+	}
+	if bestQ <= 0 {
+		return "identity"
+	}
+	return best
+}
+
+// parseAcceptEncoding parses a (possibly empty) Accept-Encoding header into
+// a map from content-coding token (or "*") to its q-weight in [0,1].
+// Tokens with no explicit q are given weight 1.
+func parseAcceptEncoding(header string) map[string]float64 {
+	prefs := make(map[string]float64)
+	if header == "" {
+		return prefs
+	}
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if parsed, err := strconv.ParseFloat(param[len("q="):], 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		prefs[name] = q
+	}
+	return prefs
+}
+
 // noopCloser is a io.WriteCloser with a no-op Close
 type noopCloser struct {
 	io.Writer
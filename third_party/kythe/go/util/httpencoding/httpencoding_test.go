@@ -0,0 +1,135 @@
+package httpencoding
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseAcceptEncoding(t *testing.T) {
+	tests := []struct {
+		header string
+		want   map[string]float64
+	}{
+		{"", map[string]float64{}},
+		{"gzip", map[string]float64{"gzip": 1}},
+		{"gzip, deflate", map[string]float64{"gzip": 1, "deflate": 1}},
+		{"gzip;q=0.5, deflate;q=0.8", map[string]float64{"gzip": 0.5, "deflate": 0.8}},
+		{"gzip;q=0", map[string]float64{"gzip": 0}},
+		{"*;q=0.1", map[string]float64{"*": 0.1}},
+		{" gzip ; q=0.5 , Deflate", map[string]float64{"gzip": 0.5, "deflate": 1}},
+	}
+	for _, test := range tests {
+		got := parseAcceptEncoding(test.header)
+		if len(got) != len(test.want) {
+			t.Errorf("parseAcceptEncoding(%q) = %v, want %v", test.header, got, test.want)
+			continue
+		}
+		for name, q := range test.want {
+			if got[name] != q {
+				t.Errorf("parseAcceptEncoding(%q)[%q] = %v, want %v", test.header, name, got[name], q)
+			}
+		}
+	}
+}
+
+func TestNegotiateEncodingPrefersHigherQWeight(t *testing.T) {
+	if got := negotiateEncoding("gzip;q=0.5, deflate;q=0.8"); got != "deflate" {
+		t.Errorf("negotiateEncoding = %q, want %q", got, "deflate")
+	}
+}
+
+func TestNegotiateEncodingQZeroForbidsEncoding(t *testing.T) {
+	if got := negotiateEncoding("gzip;q=0, deflate;q=0.5"); got != "deflate" {
+		t.Errorf("negotiateEncoding = %q, want %q (gzip excluded by q=0)", got, "deflate")
+	}
+}
+
+func TestNegotiateEncodingWildcardZeroRejectsEverything(t *testing.T) {
+	if got := negotiateEncoding("*;q=0"); got != "identity" {
+		t.Errorf("negotiateEncoding(%q) = %q, want %q", "*;q=0", got, "identity")
+	}
+}
+
+func TestNegotiateEncodingWildcardFallsBackForUnlistedEncoding(t *testing.T) {
+	// deflate isn't named explicitly, so it falls back to the "*" weight;
+	// every other registered encoding is excluded outright by its own q=0.
+	if got := negotiateEncoding("br;q=0, gzip;q=0, zstd;q=0, *;q=0.5"); got != "deflate" {
+		t.Errorf("negotiateEncoding = %q, want %q (deflate wins via wildcard fallback)", got, "deflate")
+	}
+}
+
+func TestNegotiateEncodingTieBreaksAlphabetically(t *testing.T) {
+	if got := negotiateEncoding("deflate;q=0.5, gzip;q=0.5"); got != "deflate" {
+		t.Errorf("negotiateEncoding = %q, want %q (equal q-weights break alphabetically)", got, "deflate")
+	}
+}
+
+func TestNegotiateEncodingEmptyHeaderDefaultsIdentity(t *testing.T) {
+	if got := negotiateEncoding(""); got != "identity" {
+		t.Errorf("negotiateEncoding(\"\") = %q, want %q", got, "identity")
+	}
+}
+
+func TestCompressDataBelowThresholdSendsIdentity(t *testing.T) {
+	orig := MinCompressSize
+	MinCompressSize = 1024
+	defer func() { MinCompressSize = orig }()
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	w := CompressData(rec, req)
+	body := []byte("short body")
+	if _, err := w.Write(body); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if enc := rec.Header().Get("Content-Encoding"); enc != "" {
+		t.Errorf("Content-Encoding = %q, want unset for a sub-threshold body", enc)
+	}
+	if got := rec.Body.Bytes(); !bytes.Equal(got, body) {
+		t.Errorf("body = %q, want %q", got, body)
+	}
+}
+
+func TestCompressDataAboveThresholdEncodes(t *testing.T) {
+	orig := MinCompressSize
+	MinCompressSize = 16
+	defer func() { MinCompressSize = orig }()
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	w := CompressData(rec, req)
+	body := bytes.Repeat([]byte("x"), 64)
+	if _, err := w.Write(body); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if enc := rec.Header().Get("Content-Encoding"); enc != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want %q", enc, "gzip")
+	}
+	gr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("gzip.NewReader: %v", err)
+	}
+	got, err := ioutil.ReadAll(gr)
+	if err != nil {
+		t.Fatalf("reading gzip body: %v", err)
+	}
+	if !bytes.Equal(got, body) {
+		t.Errorf("decoded body = %q, want %q", got, body)
+	}
+}
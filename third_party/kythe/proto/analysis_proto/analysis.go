@@ -0,0 +1,3 @@
+package analysis_proto
+
+type AnalysisRequest struct{}
@@ -0,0 +1,20 @@
+package sink_proto
+
+import "context"
+
+type Artifact struct {
+	Data []byte
+}
+
+type Ack struct {
+	ArtifactsReceived int64
+}
+
+type ArtifactSink_StreamArtifactsClient interface {
+	Send(*Artifact) error
+	CloseAndRecv() (*Ack, error)
+}
+
+type ArtifactSinkClient interface {
+	StreamArtifacts(ctx context.Context) (ArtifactSink_StreamArtifactsClient, error)
+}